@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var (
+	canaryBucket   string
+	canaryInterval = 30 * time.Second
+	canarySize     = 4096
+
+	canaryDeleteTimeout = 10 * time.Second
+
+	canaryRuns   int64
+	canaryFailed int64
+)
+
+// runCanary writes, reads back and deletes a small object in canaryBucket
+// every canaryInterval until the run is cancelled. It is independent of
+// the input list, so a failure here points at the write path rather than
+// at the objects being checked.
+func runCanary() {
+	ticker := time.NewTicker(canaryInterval)
+	defer ticker.Stop()
+
+	for {
+		stage, err := canaryRoundTrip()
+		atomic.AddInt64(&canaryRuns, 1)
+		if err != nil {
+			atomic.AddInt64(&canaryFailed, 1)
+			slog.Error("CANARY FAILED", "stage", stage, "bucket", canaryBucket, "err", err)
+		} else {
+			slog.Debug("canary ok", "bucket", canaryBucket)
+		}
+
+		select {
+		case <-CancelContext.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// canaryRoundTrip returns the stage that failed along with the error.
+func canaryRoundTrip() (stage string, err error) {
+	ctx := CancelContext
+	if objectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(CancelContext, objectTimeout)
+		defer cancel()
+	}
+
+	data := make([]byte, canarySize)
+	_, err = rand.Read(data)
+	if err != nil {
+		return "generate", err
+	}
+	name := fmt.Sprintf("consistency-canary/%d", time.Now().UnixNano())
+
+	_, err = client.PutObject(ctx, canaryBucket, name, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	if err != nil {
+		return "write", err
+	}
+	// the object is removed even if the read fails or times out, so the
+	// delete gets its own context instead of reusing ctx.
+	defer func() {
+		dctx, cancel := context.WithTimeout(GlobalContext, canaryDeleteTimeout)
+		defer cancel()
+		rerr := client.RemoveObject(dctx, canaryBucket, name, minio.RemoveObjectOptions{})
+		if rerr == nil {
+			return
+		}
+		if err == nil {
+			stage, err = "delete", rerr
+			return
+		}
+		slog.Warn("canary object left behind", "bucket", canaryBucket, "object", name, "err", rerr)
+	}()
+
+	mo, err := client.GetObject(ctx, canaryBucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return "read", err
+	}
+	defer mo.Close()
+
+	got, err := io.ReadAll(mo)
+	if err != nil {
+		return "read", err
+	}
+	if !bytes.Equal(got, data) {
+		return "read", fmt.Errorf("read back %d bytes that do not match the %d written", len(got), len(data))
+	}
+	return "", nil
+}
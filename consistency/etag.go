@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// objectPartSizes returns the size of every part of a multipart object,
+// paging through GetObjectAttributes until all parts are listed.
+func objectPartSizes(ctx context.Context, bucketName, objectName, versionID string) (sizes []int64, err error) {
+	marker := 0
+	for {
+		attr, err := client.GetObjectAttributes(ctx, bucketName, objectName, minio.ObjectAttributesOptions{
+			VersionID:        versionID,
+			MaxParts:         1000,
+			PartNumberMarker: marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range attr.ObjectParts.Parts {
+			sizes = append(sizes, int64(p.Size))
+		}
+		if !attr.ObjectParts.IsTruncated {
+			return sizes, nil
+		}
+		marker = attr.ObjectParts.NextPartNumberMarker
+	}
+}
+
+// verifyObjectETag reads the whole object from r and compares the recorded
+// ETag against one computed from the data. Multipart ETags (suffixed with
+// -N) are the MD5 of the concatenated part MD5s, so the part sizes are
+// fetched first and each part is hashed on its own.
+func verifyObjectETag(ctx context.Context, o *Object, bucketName, objectName string, r io.Reader) (n int64, err error) {
+	etag := strings.Trim(o.Etag, "\"")
+
+	dash := strings.LastIndex(etag, "-")
+	if dash < 0 {
+		h := md5.New()
+		n, err = io.Copy(h, r)
+		if err != nil {
+			return
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		if sum != etag {
+			err = fmt.Errorf("etag mismatch, expected %s but data hashes to %s", etag, sum)
+		}
+		return
+	}
+
+	partsCount, err := strconv.Atoi(etag[dash+1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid multipart etag %s: %s", etag, err)
+	}
+
+	sizes, err := objectPartSizes(ctx, bucketName, objectName, o.VersionID)
+	if err != nil {
+		return 0, err
+	}
+	if len(sizes) != partsCount {
+		return 0, fmt.Errorf("etag has %d parts but the object lists %d", partsCount, len(sizes))
+	}
+
+	var partSums bytes.Buffer
+	for i, size := range sizes {
+		h := md5.New()
+		pn, perr := io.CopyN(h, r, size)
+		n += pn
+		if perr != nil {
+			return n, fmt.Errorf("reading part %d: %s", i+1, perr)
+		}
+		partSums.Write(h.Sum(nil))
+	}
+
+	sum := md5.Sum(partSums.Bytes())
+	composite := hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(partsCount)
+	if composite != etag {
+		err = fmt.Errorf("etag mismatch, expected %s but parts hash to %s", etag, composite)
+	}
+	return
+}
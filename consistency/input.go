@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseInputList parses the input file according to --input-format. The
+// done and out files are always written by this tool and stay JSON.
+func parseInputList(fileMap map[string]*Object, path string) (err error) {
+	format := inputFormat
+	if format == "auto" {
+		format, err = detectInputFormat(path)
+		if err != nil {
+			return
+		}
+		slog.Info("detected input format", "format", format)
+	}
+
+	add := func(object *Object) bool {
+		return addObject(fileMap, object, path)
+	}
+	if format == "csv" {
+		return scanCSVList(path, add)
+	}
+	return scanFullList(path, add)
+}
+
+// streamInputList sends objects to objectChan while the input file is
+// still being parsed, so checking starts right away on large lists.
+// Entries already in fileMap come from the done or out file and are left
+// for pipeObjects. Only the first line for each key+version is checked,
+// unlike parseInputList where the last line wins, since a later line may
+// not have been read when the first is sent.
+func streamInputList(fileMap map[string]*Object, path string) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			log.Println("NOTE: this stacktrace is fine if we are exiting")
+			log.Println(r, string(debug.Stack()))
+		}
+	}()
+
+	format := inputFormat
+	var err error
+	if format == "auto" {
+		format, err = detectInputFormat(path)
+		if err != nil {
+			slog.Error("error parsing file", "path", path, "err", err)
+			quit <- os.Interrupt
+			return
+		}
+		slog.Info("detected input format", "format", format)
+	}
+
+	seen := make(map[string]bool)
+	var streamed int
+	add := func(object *Object) bool {
+		k := object.mapKey()
+		if seen[k] {
+			return true
+		}
+		seen[k] = true
+		if _, ok := fileMap[k]; ok {
+			return false
+		}
+		streamed++
+		objectChan <- object
+		return false
+	}
+
+	if format == "csv" {
+		err = scanCSVList(path, add)
+	} else {
+		err = scanFullList(path, add)
+	}
+	if err != nil {
+		slog.Error("error parsing file", "path", path, "err", err)
+		quit <- os.Interrupt
+		return
+	}
+	slog.Info("input streamed", "path", path, "objects", streamed)
+
+	pipeObjects()
+}
+
+// detectInputFormat treats the file as JSON when the first non-empty line
+// starts with '{' and as CSV otherwise.
+func detectInputFormat(path string) (format string, err error) {
+	filePointer, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer filePointer.Close()
+
+	scanner := bufio.NewScanner(filePointer)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '{' {
+			return "json", nil
+		}
+		return "csv", nil
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	return "json", nil
+}
+
+// scanCSVList parses a CSV list with a header row. Columns are matched to
+// object fields by name, case-insensitively: key, versionId, size, etag and
+// optionally bucket, lastModified and storageClass. Every row is treated as
+// a file.
+func scanCSVList(path string, add func(object *Object) (duplicate bool)) (err error) {
+	filePointer, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer filePointer.Close()
+
+	reader := csv.NewReader(filePointer)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading csv header: %s", err)
+	}
+	columns := make(map[string]int)
+	for i, v := range header {
+		columns[strings.ToLower(strings.TrimSpace(v))] = i
+	}
+	if _, ok := columns["key"]; !ok {
+		return errors.New("csv header has no key column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	lineCount := 1
+	duplicateCount := 0
+	for {
+		record, rerr := reader.Read()
+		if rerr == io.EOF {
+			break
+		}
+		lineCount++
+		if rerr != nil {
+			return fmt.Errorf("reading csv line %d: %s", lineCount, rerr)
+		}
+
+		if isDone() {
+			slog.Info("stopping file list parser", "path", path, "line", lineCount)
+			return errors.New("ctx done/cancelled")
+		}
+
+		object := &Object{
+			Type:         "file",
+			Key:          field(record, "key"),
+			Bucket:       field(record, "bucket"),
+			VersionID:    field(record, "versionid"),
+			Etag:         field(record, "etag"),
+			StorageClass: field(record, "storageclass"),
+		}
+		if object.Key == "" {
+			continue
+		}
+		if size := field(record, "size"); size != "" {
+			object.Size, err = strconv.Atoi(size)
+			if err != nil {
+				return fmt.Errorf("invalid size on csv line %d: %s", lineCount, err)
+			}
+		}
+		if lastModified := field(record, "lastmodified"); lastModified != "" {
+			object.LastModified, err = time.Parse(time.RFC3339, lastModified)
+			if err != nil {
+				return fmt.Errorf("invalid lastModified on csv line %d: %s", lineCount, err)
+			}
+		}
+
+		if add(object) {
+			duplicateCount++
+		}
+	}
+
+	return checkDuplicates(path, duplicateCount)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+var logLevel = "info"
+
+// setupLogger installs the default slog logger at the given level. The
+// per-object and loop messages are logged at debug so a run stays quiet
+// unless asked otherwise.
+func setupLogger(level string) error {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: l})))
+	return nil
+}
@@ -6,8 +6,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -31,11 +36,11 @@ func CatchSignal() {
 	}()
 
 	<-quit
-	fmt.Println("Quit signal caught, cleaning up and exiting")
+	slog.Info("quit signal caught, cleaning up and exiting")
 	CancelFunc()
 	close(objectChan)
 	close(concurrencyChan)
-	fmt.Println("waiting for object parser to exit...")
+	slog.Info("waiting for object parser to exit")
 	<-finalDone
 
 	time.Sleep(2 * time.Second)
@@ -58,16 +63,50 @@ var (
 	secret         string
 	key            string
 	inputFile      = "input.json"
+	inputFormat    = "json"
 	doneFile       = "done.json"
 	outFile        = "out.json"
+	failedFile     = "failed.json"
 	secure         bool
 	outFilePointer *os.File
+	outFileLock    sync.Mutex
+	outPath        string
+	syncEvery      = 100
+	unsynced       int
 	client         *minio.Client
 	BucketInfo     []minio.BucketInfo
 	GlobalContext  = context.Background()
 	CancelContext  context.Context
 	CancelFunc     context.CancelFunc
 	concurrency    = 10
+	pathStyle      bool
+	region         string
+	retryFailed    string
+	bucket         string
+	prefix         string
+	withVersions   bool
+	readMode       = "probe"
+	probeBytes     = int64(1024)
+	adaptive       bool
+	autoTune       bool
+	minConcurrency = 1
+	maxConcurrency int
+	concThrottle   *throttle
+	strictInput    bool
+	verifyETag     bool
+	samplePercent  float64
+	sampledFrom    int
+	objectTimeout  time.Duration
+	streamInput    bool
+	bucketFrom     = "key-prefix"
+
+	checkedCount  int64
+	failedCount   int64
+	timedOutCount int64
+
+	failedPath        string
+	failedFilePointer *os.File
+	failedFileLock    sync.Mutex
 
 	objectMap       = make(map[string]*Object)
 	quit            = make(chan os.Signal, 10)
@@ -85,6 +124,7 @@ type Object struct {
 	LastModified   time.Time `json:"lastModified"`
 	Size           int       `json:"size"`
 	Key            string    `json:"key"`
+	Bucket         string    `json:"bucket,omitempty"`
 	Etag           string    `json:"etag"`
 	URL            string    `json:"url"`
 	VersionID      string    `json:"versionId"`
@@ -92,19 +132,117 @@ type Object struct {
 	StorageClass   string    `json:"storageClass"`
 
 	// Custom
-	Parsed   bool `json:"parsed"`
-	Error    string
-	ReadTime int64
+	Parsed    bool `json:"parsed"`
+	Error     string
+	ErrorType string `json:",omitempty"`
+	ReadTime  int64
+	Mode      string
+
+	// listFile is the list the object was parsed from, used to tell
+	// duplicate lines apart from entries overridden by the done file.
+	listFile string
+}
+
+// mapKey identifies the object in the object map.
+func (o *Object) mapKey() string {
+	if o.Bucket != "" {
+		return o.Bucket + "/" + o.Key + o.VersionID
+	}
+	return o.Key + o.VersionID
+}
+
+// location returns the bucket and object name according to --bucket-from.
+func (o *Object) location() (bucketName, objectName string) {
+	if bucketFrom == "field" {
+		return o.Bucket, o.Key
+	}
+	keySplit := strings.Split(o.Key, "/")
+	return keySplit[0], strings.Join(keySplit[1:], "/")
 }
 
 func main() {
 	CancelContext, CancelFunc = context.WithCancel(GlobalContext)
 
-	endpoint = os.Args[1]
-	secret = os.Args[2]
-	key = os.Args[3]
+	flag.BoolVar(&pathStyle, "path-style", false, "use path-style bucket addressing instead of virtual-host")
+	flag.StringVar(&region, "region", "", "region used when signing requests")
+	flag.StringVar(&retryFailed, "retry-failed", "", "re-check only the objects that failed in a previous out file")
+	flag.StringVar(&bucket, "bucket", "", "list objects from this bucket instead of reading the input file")
+	flag.StringVar(&prefix, "prefix", "", "only list objects under this prefix, used with --bucket")
+	flag.BoolVar(&withVersions, "versions", false, "include all object versions, used with --bucket")
+	flag.StringVar(&readMode, "mode", readMode, "how objects are checked: head (stat only), probe (read --probe-bytes) or full (read everything)")
+	flag.Int64Var(&probeBytes, "probe-bytes", probeBytes, "number of bytes read per object in probe mode")
+	flag.BoolVar(&adaptive, "adaptive", false, "lower concurrency when the error rate spikes and ramp back up when it recovers")
+	flag.IntVar(&minConcurrency, "min-concurrency", minConcurrency, "lowest concurrency used in adaptive mode")
+	flag.IntVar(&maxConcurrency, "max-concurrency", 0, "highest concurrency used in adaptive mode (defaults to concurrency)")
+	flag.BoolVar(&autoTune, "auto-concurrency", false, "start at --min-concurrency and ramp up while errors and read times stay low, implies --adaptive")
+	flag.BoolVar(&strictInput, "strict-input", false, "fail if an input list contains the same key and version more than once")
+	flag.StringVar(&outPath, "out", "", "append results to this file and resume from it, instead of a new timestamped out file")
+	flag.IntVar(&syncEvery, "sync-every", syncEvery, "fsync the out file after this many records")
+	flag.BoolVar(&verifyETag, "verify-etag", false, "read each object fully and compare its data against the recorded etag, implies --mode full")
+	flag.Float64Var(&samplePercent, "sample", 0, "only check this percentage of objects, picked by a hash of key+version so the sample is the same every run")
+	flag.StringVar(&inputFile, "input", inputFile, "object list to check, one mc ls --json object per line")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9100")
+	flag.StringVar(&pprofAddr, "pprof-addr", "", "serve net/http/pprof on this address, e.g. localhost:6060")
+	flag.StringVar(&inputFormat, "input-format", inputFormat, "format of the input file: json, csv or auto")
+	flag.StringVar(&logLevel, "log-level", logLevel, "log level: debug, info, warn or error")
+	flag.StringVar(&canaryBucket, "canary", "", "periodically write, read back and delete a small object in this bucket to check the write path")
+	flag.DurationVar(&canaryInterval, "canary-interval", canaryInterval, "how often the --canary round trip runs")
+	flag.StringVar(&bucketFrom, "bucket-from", bucketFrom, "where the bucket name comes from: key-prefix (first segment of key) or field (the bucket field)")
+	flag.BoolVar(&streamInput, "stream", false, "start checking objects while the input file is still being parsed, the first line for a repeated key and version is checked instead of the last. Cannot be used with --bucket, --retry-failed, --sample or --strict-input")
+	flag.DurationVar(&objectTimeout, "object-timeout", 0, "give up on an object after this long and record it as a timeout, e.g. 30s (0 disables)")
+	flag.Parse()
+
+	if err := setupLogger(logLevel); err != nil {
+		fmt.Println("invalid --log-level:", err)
+		os.Exit(1)
+	}
+
+	if inputFormat != "json" && inputFormat != "csv" && inputFormat != "auto" {
+		fmt.Println("invalid --input-format:", inputFormat, "expected json, csv or auto")
+		os.Exit(1)
+	}
 
-	conInt, err := strconv.Atoi(os.Args[4])
+	if verifyETag {
+		readMode = "full"
+	}
+
+	if readMode != "head" && readMode != "probe" && readMode != "full" {
+		fmt.Println("invalid --mode:", readMode, "expected head, probe or full")
+		os.Exit(1)
+	}
+
+	if probeBytes <= 0 {
+		fmt.Println("invalid --probe-bytes:", probeBytes, "expected a positive number")
+		os.Exit(1)
+	}
+
+	if bucketFrom != "key-prefix" && bucketFrom != "field" {
+		fmt.Println("invalid --bucket-from:", bucketFrom, "expected key-prefix or field")
+		os.Exit(1)
+	}
+
+	if streamInput && (bucket != "" || retryFailed != "" || samplePercent > 0 || strictInput) {
+		fmt.Println("--stream cannot be used with --bucket, --retry-failed, --sample or --strict-input")
+		os.Exit(1)
+	}
+
+	if canaryBucket != "" && canaryInterval <= 0 {
+		fmt.Println("invalid --canary-interval:", canaryInterval, "expected a positive duration")
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) < 4 {
+		fmt.Println("usage: consistency [flags] [endpoint] [secret] [key] [concurrency]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	endpoint = args[0]
+	secret = args[1]
+	key = args[2]
+
+	conInt, err := strconv.Atoi(args[3])
 	if err != nil {
 		panic(err)
 	}
@@ -114,23 +252,88 @@ func main() {
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	go CatchSignal()
 
-	concurrencyChan = make(chan int, concurrency)
-	for i := 1; i <= concurrency; i++ {
-		concurrencyChan <- i
+	if autoTune {
+		adaptive = true
+	}
+
+	if adaptive {
+		if maxConcurrency < concurrency {
+			maxConcurrency = concurrency
+		}
+		initial := concurrency
+		if autoTune {
+			initial = minConcurrency
+		}
+		concThrottle = newThrottle(initial, minConcurrency, maxConcurrency)
+		concThrottle.watchLatency = autoTune
+		concurrencyChan = make(chan int, maxConcurrency)
+		concThrottle.fill(concurrencyChan)
+	} else {
+		concurrencyChan = make(chan int, concurrency)
+		for i := 1; i <= concurrency; i++ {
+			concurrencyChan <- i
+		}
 	}
 
 	fmt.Println("_____ STARTING CONSISTENCY CHECKER _____")
 	fmt.Println("endpoint:", endpoint)
 	fmt.Println("secret:", secret)
 	fmt.Println("key:", key)
-	fmt.Println("inputFile:", inputFile)
-	fmt.Println("doneFile:", doneFile)
+	if retryFailed != "" {
+		fmt.Println("retryFailed:", retryFailed)
+	} else if bucket != "" {
+		fmt.Println("bucket:", bucket)
+		fmt.Println("prefix:", prefix)
+		fmt.Println("versions:", withVersions)
+		fmt.Println("doneFile:", doneFile)
+	} else {
+		fmt.Println("inputFile:", inputFile)
+		fmt.Println("inputFormat:", inputFormat)
+		fmt.Println("stream:", streamInput)
+		fmt.Println("doneFile:", doneFile)
+	}
 	fmt.Println("concurrency:", concurrency)
+	if adaptive {
+		fmt.Println("autoConcurrency:", autoTune)
+		fmt.Println("minConcurrency:", minConcurrency)
+		fmt.Println("maxConcurrency:", maxConcurrency)
+	}
+	fmt.Println("mode:", readMode)
+	fmt.Println("verifyETag:", verifyETag)
+	if objectTimeout > 0 {
+		fmt.Println("objectTimeout:", objectTimeout)
+	}
+	if samplePercent > 0 {
+		fmt.Println("sample:", samplePercent)
+	}
+	if readMode == "probe" {
+		fmt.Println("probeBytes:", probeBytes)
+	}
+	if canaryBucket != "" {
+		fmt.Println("canary:", canaryBucket)
+		fmt.Println("canaryInterval:", canaryInterval)
+	}
+	fmt.Println("bucketFrom:", bucketFrom)
+	fmt.Println("pathStyle:", pathStyle)
+	fmt.Println("region:", region)
 
 	fileTimePreFix := time.Now().Format("2006-01-02-15-04-05")
+	appendOut := outPath != ""
+	outFlags := os.O_CREATE | os.O_RDWR
+	if appendOut {
+		err = trimPartialLine(outPath)
+		if err != nil {
+			fmt.Println("error checking out file:", err)
+			os.Exit(1)
+		}
+		outFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else {
+		outPath = fileTimePreFix + "." + outFile
+	}
+	failedPath = fileTimePreFix + "." + failedFile
 	outFilePointer, err = os.OpenFile(
-		fileTimePreFix+"."+outFile,
-		os.O_CREATE|os.O_RDWR,
+		outPath,
+		outFlags,
 		0o777,
 	)
 	if err != nil {
@@ -138,32 +341,60 @@ func main() {
 		os.Exit(1)
 	}
 
-	fmt.Println("outFile:", fileTimePreFix+"."+outFile)
+	fmt.Println("outFile:", outPath)
+	fmt.Println("failedFile:", failedPath)
 	fmt.Println("_____ STARTING CONSISTENCY CHECKER _____")
 
 	if strings.Contains(endpoint, "https") {
 		secure = true
 	}
 
-	err = parseFullList(objectMap, inputFile)
+	err = makeClient()
 	if err != nil {
-		fmt.Println("error parsing file:", err)
+		fmt.Println("error creating minio client:", err)
 		os.Exit(1)
 	}
 
-	_, err = os.Stat(doneFile)
-	if err == nil {
-		err = parseFullList(objectMap, doneFile)
+	if retryFailed != "" {
+		err = parseFailedList(objectMap, retryFailed)
 		if err != nil {
 			fmt.Println("error parsing file:", err)
 			os.Exit(1)
 		}
+	} else {
+		if bucket != "" {
+			err = listBucket(objectMap, bucket, prefix)
+			if err != nil {
+				fmt.Println("error listing bucket:", err)
+				os.Exit(1)
+			}
+		} else if !streamInput {
+			err = parseInputList(objectMap, inputFile)
+			if err != nil {
+				fmt.Println("error parsing file:", err)
+				os.Exit(1)
+			}
+		}
+
+		// the done file is optional, but one that exists must be readable
+		err = parseFullList(objectMap, doneFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("error parsing file:", err)
+			os.Exit(1)
+		}
+
+		// an appended out file doubles as the done list when resuming
+		if appendOut {
+			err = parseFullList(objectMap, outPath)
+			if err != nil {
+				fmt.Println("error parsing file:", err)
+				os.Exit(1)
+			}
+		}
 	}
 
-	err = makeClient()
-	if err != nil {
-		fmt.Println("error creating minio client:", err)
-		os.Exit(1)
+	if samplePercent > 0 && samplePercent < 100 {
+		sampleObjects(objectMap, samplePercent)
 	}
 
 	fmt.Println("_____ FILE STATES ______")
@@ -179,14 +410,49 @@ func main() {
 	fmt.Println("Finished Files:", doneCount)
 	fmt.Println("Remaining Files:", remainingCount)
 	fmt.Println("Total Files:", len(objectMap))
+	if streamInput {
+		fmt.Println("Input Files: streamed from", inputFile)
+	}
+	if sampledFrom > 0 {
+		fmt.Printf("Sample: %d of %d files (%.2f%%)\n", len(objectMap), sampledFrom, samplePercent)
+	}
 	fmt.Println("_____ FILE STATES ______")
 
+	if metricsAddr != "" {
+		fmt.Println("metrics:", "http://"+metricsAddr+"/metrics")
+		startMetricsServer(metricsAddr)
+	}
+	if pprofAddr != "" {
+		fmt.Println("pprof:", "http://"+pprofAddr+"/debug/pprof/")
+		startPprofServer(pprofAddr)
+	}
+
 	start = time.Now()
-	go pipeObjects()
+	if canaryBucket != "" {
+		go runCanary()
+	}
+	if streamInput {
+		go streamInputList(objectMap, inputFile)
+	} else {
+		go pipeObjects()
+	}
 	readObjectsToCheckConsistency()
 }
 
+// parseFullList parses a done, out or failed list. These are written by
+// this tool and a resumed run appends a new line for every object it
+// checks again, so the last line for each object wins and repeated lines
+// are not counted as duplicates.
 func parseFullList(fileMap map[string]*Object, path string) (err error) {
+	return scanFullList(path, func(object *Object) bool {
+		addObject(fileMap, object, path)
+		return false
+	})
+}
+
+// scanFullList calls add for every file entry in the list, add reports
+// whether the entry was a duplicate.
+func scanFullList(path string, add func(object *Object) (duplicate bool)) (err error) {
 	filePointer, err := os.Open(path)
 	if err != nil {
 		return
@@ -194,12 +460,24 @@ func parseFullList(fileMap map[string]*Object, path string) (err error) {
 	defer filePointer.Close()
 
 	lineCount := 0
+	duplicateCount := 0
+	var badLine []byte
+	var badErr error
 	scanner := bufio.NewScanner(filePointer)
 	for scanner.Scan() {
 		lineCount++
 
+		// a line that fails to parse is only allowed as the last line of
+		// the out file, where it is the partial write of a run that was
+		// killed.
+		if badLine != nil {
+			fmt.Println("could not unmarshal line:", path, " // err:", badErr)
+			fmt.Println("LINE: ", string(badLine))
+			os.Exit(1)
+		}
+
 		if isDone() {
-			fmt.Println("Stopping file list parser, was parsing: ", path, " ... stopped on line:", lineCount)
+			slog.Info("stopping file list parser", "path", path, "line", lineCount)
 			return errors.New("ctx done/cancelled")
 		}
 		// time.Sleep(1 * time.Second)
@@ -212,12 +490,17 @@ func parseFullList(fileMap map[string]*Object, path string) (err error) {
 		object := new(Object)
 		err := json.Unmarshal(b, object)
 		if err != nil {
-			fmt.Println("could not unmarshal line:", path, " // err:", err)
-			fmt.Println("LINE: ", string(b))
-			os.Exit(1)
+			if path != outPath {
+				fmt.Println("could not unmarshal line:", path, " // err:", err)
+				fmt.Println("LINE: ", string(b))
+				os.Exit(1)
+			}
+			badLine = append([]byte{}, b...)
+			badErr = err
+			continue
 		}
-		if object.Type == "file" {
-			fileMap[object.Key+object.VersionID] = object
+		if object.Type == "file" && add(object) {
+			duplicateCount++
 		}
 		// fmt.Println(object)
 	}
@@ -227,9 +510,137 @@ func parseFullList(fileMap map[string]*Object, path string) (err error) {
 		fmt.Println("error reading file:", err)
 		return
 	}
+
+	if badLine != nil {
+		slog.Warn("skipping partial last line", "path", path, "line", string(badLine))
+	}
+
+	return checkDuplicates(path, duplicateCount)
+}
+
+// addObject adds object to fileMap and reports whether the same key and
+// version was already added from the same list.
+func addObject(fileMap map[string]*Object, object *Object, path string) (duplicate bool) {
+	object.listFile = path
+	existing, ok := fileMap[object.mapKey()]
+	fileMap[object.mapKey()] = object
+	return ok && existing.listFile == path
+}
+
+func checkDuplicates(path string, duplicateCount int) error {
+	if duplicateCount == 0 {
+		return nil
+	}
+	slog.Warn("duplicate lines merged", "path", path, "count", duplicateCount)
+	if strictInput {
+		return fmt.Errorf("%d duplicate key+version lines in %s", duplicateCount, path)
+	}
+	return nil
+}
+
+// parseFailedList loads a previous out file and keeps only the objects
+// that recorded an error, resetting them so they go through the pipeline again.
+func parseFailedList(fileMap map[string]*Object, path string) (err error) {
+	err = parseFullList(fileMap, path)
+	if err != nil {
+		return
+	}
+
+	for i, o := range fileMap {
+		if o.Error == "" {
+			delete(fileMap, i)
+			continue
+		}
+		o.Error = ""
+		o.ErrorType = ""
+		o.Parsed = false
+		o.ReadTime = 0
+	}
 	return
 }
 
+// listBucket lists the bucket directly and adds the objects in the same
+// bucket/key form that mc ls produces, so no input file is needed.
+func listBucket(fileMap map[string]*Object, bucket string, prefix string) (err error) {
+	count := 0
+	for oi := range client.ListObjects(CancelContext, bucket, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithVersions: withVersions,
+	}) {
+		if oi.Err != nil {
+			return oi.Err
+		}
+		if oi.IsDeleteMarker || strings.HasSuffix(oi.Key, "/") {
+			continue
+		}
+
+		object := &Object{
+			Status:       "success",
+			Type:         "file",
+			LastModified: oi.LastModified,
+			Size:         int(oi.Size),
+			Key:          bucket + "/" + oi.Key,
+			Etag:         oi.ETag,
+			VersionID:    oi.VersionID,
+			StorageClass: oi.StorageClass,
+		}
+		if bucketFrom == "field" {
+			object.Bucket = bucket
+			object.Key = oi.Key
+		}
+		fileMap[object.mapKey()] = object
+
+		count++
+		if count%10000 == 0 {
+			slog.Info("listed objects", "count", count)
+		}
+	}
+
+	if isDone() {
+		return errors.New("ctx done/cancelled")
+	}
+	return
+}
+
+// sampleObjects keeps roughly percent% of the objects. The choice is made
+// from a hash of key+version so repeated runs select the same objects.
+func sampleObjects(fileMap map[string]*Object, percent float64) {
+	sampledFrom = len(fileMap)
+	cutoff := uint64(percent * 100)
+	for i := range fileMap {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(i))
+		if h.Sum64()%10000 >= cutoff {
+			delete(fileMap, i)
+		}
+	}
+}
+
+func printSummary() {
+	checked := atomic.LoadInt64(&checkedCount)
+	failed := atomic.LoadInt64(&failedCount)
+	fmt.Println("_____ SUMMARY ______")
+	fmt.Println("objects checked:", checked)
+	fmt.Println("objects failed:", failed)
+	if objectTimeout > 0 {
+		fmt.Println("objects timed out:", atomic.LoadInt64(&timedOutCount))
+	}
+	if checked > 0 {
+		rate := float64(failed) / float64(checked)
+		fmt.Printf("error rate: %.4f%%\n", rate*100)
+		if sampledFrom > 0 {
+			fmt.Println("sampled from:", sampledFrom)
+			fmt.Printf("extrapolated failures: ~%.0f of %d\n", rate*float64(sampledFrom), sampledFrom)
+		}
+	}
+	if canaryBucket != "" {
+		fmt.Println("canary round trips:", atomic.LoadInt64(&canaryRuns))
+		fmt.Println("canary failed:", atomic.LoadInt64(&canaryFailed))
+	}
+	fmt.Println("_____ SUMMARY ______")
+}
+
 func makeClient() (err error) {
 	trans, terr := createHTTPTransport()
 	if terr != nil {
@@ -239,11 +650,19 @@ func makeClient() (err error) {
 	}
 	finalEnd := strings.TrimPrefix(endpoint, "https://")
 	finalEnd = strings.TrimPrefix(finalEnd, "http://")
+
+	lookup := minio.BucketLookupAuto
+	if pathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
 	client, err = minio.New(finalEnd,
 		&minio.Options{
-			Creds:     credentials.NewStaticV4(key, secret, ""),
-			Secure:    secure,
-			Transport: trans,
+			Creds:        credentials.NewStaticV4(key, secret, ""),
+			Secure:       secure,
+			Transport:    trans,
+			Region:       region,
+			BucketLookup: lookup,
 		})
 	if err != nil {
 		return
@@ -274,14 +693,14 @@ loop:
 		// fmt.Println("concurrency ID:", cid)
 
 		if isDone() {
-			fmt.Println("context done or cancelled, exiting object parser loop")
+			slog.Debug("context done or cancelled, exiting object parser loop")
 			break
 		}
 
 		select {
 		case o, ok := <-objectChan:
 			if !ok {
-				fmt.Println("concurrency channel closed: !ok read")
+				slog.Debug("concurrency channel closed: !ok read")
 				break loop
 			}
 
@@ -289,7 +708,7 @@ loop:
 			go readObject(o, cid, &wg)
 		default:
 			if pipeDONE {
-				fmt.Println("pipe complete, exiting reader loop")
+				slog.Debug("pipe complete, exiting reader loop")
 				break loop
 			}
 			concurrencyChan <- cid
@@ -298,19 +717,25 @@ loop:
 		}
 	}
 
-	fmt.Println("object parser exiting...")
-	fmt.Println("currently processing:", cap(concurrencyChan)-len(concurrencyChan))
-	fmt.Println("waiting for in-progress objects to finish...")
+	slog.Debug("object parser exiting", "processing", cap(concurrencyChan)-len(concurrencyChan))
+	slog.Debug("waiting for in-progress objects to finish")
 	wg.Wait()
-	fmt.Println("objects in queue:", len(objectChan))
-	fmt.Println("object parser done")
+	slog.Debug("object parser done", "queued", len(objectChan))
 	fmt.Println("total runtime in minutes:", time.Since(start).Minutes())
+	printSummary()
 
 	if outFilePointer != nil {
 		_ = outFilePointer.Sync()
 		_ = outFilePointer.Close()
 	}
 
+	failedFileLock.Lock()
+	if failedFilePointer != nil {
+		_ = failedFilePointer.Sync()
+		_ = failedFilePointer.Close()
+	}
+	failedFileLock.Unlock()
+
 	finalDone <- struct{}{}
 }
 
@@ -326,6 +751,10 @@ func pipeObjects() {
 
 	for i := range objectMap {
 		if objectMap[i].Parsed {
+			if objectMap[i].listFile == outPath {
+				// already recorded in the file we are appending to
+				continue
+			}
 			err := saveFinishedObject(objectMap[i])
 			if err != nil {
 				return
@@ -335,7 +764,7 @@ func pipeObjects() {
 		}
 
 		if isDone() {
-			fmt.Println("ctx cancel: object file pipe closing")
+			slog.Debug("ctx cancel: object file pipe closing")
 			break
 		}
 
@@ -344,29 +773,50 @@ func pipeObjects() {
 }
 
 func readObject(o *Object, cid int, wg *sync.WaitGroup) {
-	var mo *minio.Object
 	var err error
-	var n int
+	var n int64
+	ctx := CancelContext
+	cancel := func() {}
+	if objectTimeout > 0 {
+		ctx, cancel = context.WithTimeout(CancelContext, objectTimeout)
+	}
+	// registered first so it runs after the result has been saved
+	defer wg.Done()
+	// and cancel only after the result closure has looked at ctx
+	defer cancel()
 	defer func() {
 		r := recover()
 		if r != nil {
 			log.Println(r, string(debug.Stack()))
 		}
-		wg.Done()
 
-		if mo != nil {
-			if n < 0 && o.Size > 0 {
-				o.Error = "no bytes read"
-			} else if err != nil {
-				o.Error = err.Error()
-			} else {
-				o.Parsed = true
+		o.Mode = readMode
+		if err != nil {
+			o.Error = err.Error()
+			switch {
+			case errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded:
+				o.ErrorType = "timeout"
+				atomic.AddInt64(&timedOutCount, 1)
+			case CancelContext.Err() != nil:
+				o.ErrorType = "cancelled"
+			default:
+				o.ErrorType = "error"
 			}
+			atomic.AddInt64(&failedCount, 1)
+		} else if n <= 0 && o.Size > 0 && readMode != "head" {
+			o.Error = "no bytes read"
+			o.ErrorType = "error"
+			atomic.AddInt64(&failedCount, 1)
 		} else {
-			o.Error = "minio sdk returned nil object"
+			o.Parsed = true
 		}
+		atomic.AddInt64(&checkedCount, 1)
+		recordMetrics(o, n)
 
 		_ = saveFinishedObject(o)
+		if o.Error != "" {
+			saveFailedObject(o)
+		}
 
 		if isDone() {
 			// fmt.Println("ctx cancel: not returning id to concurrency channel")
@@ -374,22 +824,69 @@ func readObject(o *Object, cid int, wg *sync.WaitGroup) {
 		}
 
 		// fmt.Println("returning ID", cid)
-		concurrencyChan <- cid
+		if concThrottle != nil {
+			concThrottle.release(concurrencyChan, cid, o.Error != "", o.ReadTime)
+		} else {
+			concurrencyChan <- cid
+		}
 	}()
 
 	start := time.Now()
-	keySplit := strings.Split(o.Key, "/")
-	mo, err = client.GetObject(GlobalContext, keySplit[0], strings.Join(keySplit[1:], ""), minio.GetObjectOptions{})
-	if err != nil {
-		fmt.Println("ERR:", o.Key, " || err:", err)
+	bucketName, objectName := o.location()
+	if bucketName == "" {
+		err = fmt.Errorf("no bucket for key %s with --bucket-from %s", o.Key, bucketFrom)
 		return
 	}
-	if mo != nil {
+
+	if readMode == "head" {
+		_, err = client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{
+			VersionID: o.VersionID,
+		})
 		o.ReadTime = time.Since(start).Milliseconds()
-		tmp := make([]byte, 1024)
-		n, err = mo.Read(tmp)
-		_ = mo.Close()
+		if err != nil {
+			slog.Debug("object read failed", "key", o.Key, "err", err)
+		}
+		return
 	}
+
+	// each listed version is read as itself, not as the latest version
+	var mo *minio.Object
+	mo, err = client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{
+		VersionID: o.VersionID,
+	})
+	if err != nil {
+		slog.Debug("object read failed", "key", o.Key, "err", err)
+		return
+	}
+	if mo == nil {
+		err = errors.New("minio sdk returned nil object")
+		return
+	}
+	defer mo.Close()
+
+	if verifyETag {
+		n, err = verifyObjectETag(ctx, o, bucketName, objectName, mo)
+	} else if readMode == "full" {
+		n, err = io.Copy(io.Discard, mo)
+		if err == nil && n != int64(o.Size) {
+			err = fmt.Errorf("size mismatch, expected %d bytes but read %d", o.Size, n)
+		}
+	} else {
+		want := probeBytes
+		if int64(o.Size) < want {
+			want = int64(o.Size)
+		}
+		if want == 0 {
+			// GetObject is lazy and a zero byte read sends no request,
+			// so stat the object to make sure it is fetched at all.
+			_, err = mo.Stat()
+		} else {
+			var rn int
+			rn, err = io.ReadFull(mo, make([]byte, want))
+			n = int64(rn)
+		}
+	}
+	o.ReadTime = time.Since(start).Milliseconds()
 }
 
 func saveFinishedObject(o *Object) (err error) {
@@ -411,6 +908,13 @@ func saveFinishedObject(o *Object) (err error) {
 	if err != nil {
 		return err
 	}
+	// object and newline go out in a single write so a killed run
+	// can only ever leave a partial last line behind.
+	jsonOut = append(jsonOut, 10)
+
+	outFileLock.Lock()
+	defer outFileLock.Unlock()
+
 	var n int
 	n, err = outFilePointer.Write(jsonOut)
 	if err != nil {
@@ -419,12 +923,93 @@ func saveFinishedObject(o *Object) (err error) {
 	if n != len(jsonOut) {
 		return errors.New("error writing finished object to json, write inconsistency")
 	}
-	n, err = outFilePointer.Write([]byte{10})
+
+	unsynced++
+	if unsynced >= syncEvery {
+		unsynced = 0
+		err = outFilePointer.Sync()
+	}
+	return
+}
+
+// saveFailedObject writes o to the failed file in the same format as the
+// input list so it can be passed back in with --input. The file is only
+// created once the first object fails.
+func saveFailedObject(o *Object) {
+	failedFileLock.Lock()
+	defer failedFileLock.Unlock()
+
+	var err error
+	if failedFilePointer == nil {
+		failedFilePointer, err = os.OpenFile(failedPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o777)
+		if err != nil {
+			slog.Error("error opening or creating failed file", "err", err)
+			return
+		}
+	}
+
+	retry := *o
+	retry.Parsed = false
+	retry.Error = ""
+	retry.ErrorType = ""
+	retry.ReadTime = 0
+	retry.Mode = ""
+
+	jsonOut, err := json.Marshal(&retry)
+	if err != nil {
+		slog.Error("error saving failed object", "err", err)
+		return
+	}
+	_, err = failedFilePointer.Write(append(jsonOut, 10))
+	if err != nil {
+		slog.Error("error saving failed object", "err", err)
+	}
+}
+
+// trimPartialLine truncates path after its last newline, dropping the
+// incomplete record a killed run may have left at the end.
+func trimPartialLine(path string) (err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o777)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
 	if err != nil {
 		return err
 	}
-	if n != 1 {
-		return errors.New("error writing newline, write inconsistency")
+	size := stat.Size()
+	if size == 0 {
+		return nil
 	}
-	return
+
+	buf := make([]byte, 4096)
+	end := size
+	for end > 0 {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		_, err = f.ReadAt(chunk, start)
+		if err != nil {
+			return err
+		}
+		index := bytes.LastIndexByte(chunk, 10)
+		if index > -1 {
+			end = start + int64(index) + 1
+			break
+		}
+		end = start
+	}
+
+	if end == size {
+		return nil
+	}
+	slog.Warn("dropping partial last line", "path", path, "bytes", size-end)
+	return f.Truncate(end)
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsAddr string
+
+	objectsChecked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consistency_objects_checked_total",
+		Help: "Objects checked so far.",
+	})
+	objectsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consistency_objects_failed_total",
+		Help: "Objects that recorded an error.",
+	})
+	bytesRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consistency_bytes_read_total",
+		Help: "Object bytes read.",
+	})
+	readTime = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "consistency_read_time_seconds",
+		Help:    "Time spent checking each object.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+)
+
+// startMetricsServer exposes the sweep counters in Prometheus format on
+// addr. The server runs for the lifetime of the process.
+func startMetricsServer(addr string) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(objectsChecked, objectsFailed, bytesRead, readTime)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			slog.Error("metrics server stopped", "err", err)
+		}
+	}()
+}
+
+func recordMetrics(o *Object, n int64) {
+	objectsChecked.Inc()
+	if o.Error != "" {
+		objectsFailed.Inc()
+	}
+	if n > 0 {
+		bytesRead.Add(float64(n))
+	}
+	readTime.Observe(float64(o.ReadTime) / 1000)
+}
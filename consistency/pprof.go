@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+var pprofAddr string
+
+// startPprofServer serves the net/http/pprof handlers on addr so goroutine
+// dumps and heap profiles can be taken from a running sweep, e.g.
+// curl http://addr/debug/pprof/goroutine?debug=1 > goroutines.txt
+func startPprofServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			slog.Error("pprof server stopped", "err", err)
+		}
+	}()
+}
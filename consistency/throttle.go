@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+const (
+	throttleWindow       = 50
+	throttleHighWater    = 0.10
+	throttleLowWater     = 0.01
+	throttleLatencySpike = 2.0
+)
+
+// throttle adjusts how many concurrency IDs are handed out based on the
+// error rate over the last throttleWindow objects, and optionally on their
+// average read time. IDs above the current limit are parked instead of
+// being returned to concurrencyChan, which keeps the number of in-flight
+// reads at or below the limit.
+type throttle struct {
+	mu     sync.Mutex
+	limit  int
+	min    int
+	max    int
+	parked []int
+
+	window   []bool
+	readTime []int64
+	pos      int
+	filled   int
+
+	// watchLatency backs off when the average read time of a window is
+	// more than throttleLatencySpike times the best average seen so far.
+	watchLatency bool
+	bestLatency  float64
+}
+
+func newThrottle(initial, min, max int) *throttle {
+	if min < 1 {
+		min = 1
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+	return &throttle{
+		limit:    initial,
+		min:      min,
+		max:      max,
+		window:   make([]bool, throttleWindow),
+		readTime: make([]int64, throttleWindow),
+	}
+}
+
+// fill hands out the initial IDs and parks the ones above the limit.
+func (t *throttle) fill(c chan int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := 1; i <= t.max; i++ {
+		if i <= t.limit {
+			c <- i
+		} else {
+			t.parked = append(t.parked, i)
+		}
+	}
+}
+
+// release records the outcome of an object read and returns cid to c,
+// unless the limit has been lowered in which case cid is parked.
+func (t *throttle) release(c chan int, cid int, failed bool, readTime int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.window[t.pos] = failed
+	t.readTime[t.pos] = readTime
+	t.pos = (t.pos + 1) % len(t.window)
+	if t.filled < len(t.window) {
+		t.filled++
+	}
+
+	if t.filled == len(t.window) {
+		errorCount := 0
+		for _, v := range t.window {
+			if v {
+				errorCount++
+			}
+		}
+		rate := float64(errorCount) / float64(len(t.window))
+
+		var total int64
+		for _, v := range t.readTime {
+			total += v
+		}
+		latency := float64(total) / float64(len(t.readTime))
+		spike := false
+		if t.watchLatency {
+			if t.bestLatency == 0 || latency < t.bestLatency {
+				t.bestLatency = latency
+			}
+			spike = t.bestLatency > 0 && latency > t.bestLatency*throttleLatencySpike
+		}
+
+		newLimit := t.limit
+		if rate > throttleHighWater && t.limit > t.min {
+			newLimit = t.limit / 2
+		} else if spike && t.limit > t.min {
+			newLimit = t.limit * 3 / 4
+		} else if rate < throttleLowWater && t.limit < t.max {
+			newLimit = t.limit + 1 + t.limit/10
+		}
+		if newLimit < t.min {
+			newLimit = t.min
+		}
+		if newLimit > t.max {
+			newLimit = t.max
+		}
+
+		if newLimit != t.limit {
+			slog.Info("concurrency changed", "from", t.limit, "to", newLimit, "errorRate", rate, "avgReadTimeMs", latency)
+			t.limit = newLimit
+			t.filled = 0
+			t.pos = 0
+		}
+	}
+
+	active := t.max - len(t.parked)
+	if active > t.limit {
+		t.parked = append(t.parked, cid)
+		return
+	}
+
+	c <- cid
+	for active < t.limit && len(t.parked) > 0 {
+		c <- t.parked[len(t.parked)-1]
+		t.parked = t.parked[:len(t.parked)-1]
+		active++
+	}
+}
@@ -11,6 +11,12 @@ import (
 	"strings"
 )
 
+var (
+	pattern     = []byte{0, 9, 231, 69}
+	chunkSize   = 1024 * 1024
+	contextSize = 300
+)
+
 func main() {
 	find()
 }
@@ -35,18 +41,29 @@ func offsets() {
 func find() {
 	dr := os.DirFS(".")
 	fs.WalkDir(dr, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if !strings.Contains(path, "F3") {
+			return nil
+		}
 		// if strings.Contains(path, "goroutines.txt") {
 		// log.Println(path)
 		f, err := os.Open(path)
 		if err != nil {
-			defer f.Close()
+			log.Println(err)
+			return nil
 		}
-		fb, _ := io.ReadAll(f)
-		index := bytes.Index(fb, []byte{0, 9, 231, 69})
-		if index > -1 && strings.Contains(path, "F3") {
-			// if index > -1 {
-			log.Println("FOUND IT:", path)
-			fmt.Println(fb[index : index+300])
+		defer f.Close()
+
+		found, err := findInFile(f, pattern)
+		if err != nil {
+			log.Println(path, err)
+			return nil
+		}
+		for _, offset := range found {
+			log.Println("FOUND IT:", path, "offset:", offset)
+			fmt.Println(readContext(f, offset))
 		}
 		// log.Println(d)
 		// log.Println(err)
@@ -54,3 +71,59 @@ func find() {
 		return nil
 	})
 }
+
+// findInFile streams r in chunkSize pieces and returns the byte offset of
+// every occurrence of p. The last len(p)-1 bytes of each chunk are carried
+// over into the next one so matches spanning a chunk boundary are found,
+// while a carried tail is too short to hold a full match on its own and
+// can never be reported twice.
+func findInFile(r io.Reader, p []byte) (offsets []int64, err error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+
+	overlap := len(p) - 1
+	buf := make([]byte, chunkSize+overlap)
+	carried := 0
+	var base int64
+	for {
+		n, rerr := io.ReadFull(r, buf[carried:])
+		window := buf[:carried+n]
+
+		pos := 0
+		for {
+			index := bytes.Index(window[pos:], p)
+			if index < 0 {
+				break
+			}
+			offsets = append(offsets, base+int64(pos+index))
+			pos += index + 1
+		}
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			return offsets, nil
+		}
+		if rerr != nil {
+			return offsets, rerr
+		}
+
+		keep := overlap
+		if keep > len(window) {
+			keep = len(window)
+		}
+		copy(buf, window[len(window)-keep:])
+		base += int64(len(window) - keep)
+		carried = keep
+	}
+}
+
+// readContext returns up to contextSize bytes starting at offset, stopping
+// early at the end of the file.
+func readContext(f *os.File, offset int64) []byte {
+	buf := make([]byte, contextSize)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		log.Println(err)
+	}
+	return buf[:n]
+}
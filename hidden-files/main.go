@@ -4,8 +4,11 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -21,6 +24,8 @@ var (
 	FIX   = "FILENAME"
 	BLOCK = 1000000
 
+	WIPE_WORKERS = 4
+
 	// META
 	META_start uint64 = 0
 	META_end   uint64 = 10000000
@@ -57,7 +62,15 @@ func main() {
 
 	command := os.Args[1]
 	if command == "ls" {
-		LS()
+		if len(os.Args) > 2 && os.Args[2] == "--json" {
+			err := LS_JSON(os.Stdout)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		} else {
+			LS()
+		}
 	} else if command == "w" {
 		_, _ = WRITE_META([]byte(os.Args[3]), os.Args[2])
 		_, _ = WRITE([]byte(os.Args[3]))
@@ -75,14 +88,13 @@ func main() {
 			return
 		}
 		defer f.Close()
-		fb, err := io.ReadAll(f)
+
+		written, err := COPY(f, f.Name())
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-
-		_, _ = WRITE_META(fb, f.Name())
-		_, _ = WRITE(fb)
+		fmt.Println("COPIED BYTES:", written)
 	} else if command == "cat" {
 		CAT(os.Args[2])
 	} else if command == "wipe" {
@@ -100,6 +112,59 @@ func LS() {
 	}
 }
 
+type LS_ENTRY struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Size     uint64 `json:"size"`
+	Start    uint64 `json:"start"`
+	End      uint64 `json:"end"`
+	Checksum string `json:"checksum"`
+}
+
+// LS_JSON lists every file with a SHA-256 of its data on disk. The meta
+// entries have no checksum of their own, so it is computed on each call.
+func LS_JSON(w io.Writer) error {
+	file, err := os.OpenFile(DISK, os.O_RDONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries := make([]LS_ENTRY, 0, len(M.Files))
+	for i := 0; i < len(M.Files); i++ {
+		v := M.Files[i]
+		sum, err := CHECKSUM(file, v)
+		if err != nil {
+			return fmt.Errorf("checksum of %s: %s", v.Name, err)
+		}
+		entries = append(entries, LS_ENTRY{
+			Index:    i,
+			Name:     v.Name,
+			Size:     v.Size,
+			Start:    v.Start,
+			End:      v.End,
+			Checksum: sum,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// CHECKSUM returns the hex SHA-256 of the bytes stored for f.
+func CHECKSUM(file *os.File, f *FILE) (string, error) {
+	h := sha256.New()
+	section := io.NewSectionReader(file, int64(META_end+f.Start), int64(f.End-f.Start))
+	n, err := io.Copy(h, section)
+	if err != nil {
+		return "", err
+	}
+	if uint64(n) != f.End-f.Start {
+		return "", fmt.Errorf("read %d of %d bytes", n, f.End-f.Start)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func TEST_WRITE() {
 	key := []byte("098765432109876543210987654321XX")
 	data := []byte("MY SECRET KEY!")
@@ -160,6 +225,45 @@ func WRITE(data []byte) (written int, err error) {
 	return
 }
 
+// COPY streams src to the disk in BLOCK sized chunks starting at the next
+// file offset and writes the meta entry once the final size is known, so
+// the source is never held in memory as a whole.
+func COPY(src io.Reader, name string) (written uint64, err error) {
+	file, err := os.OpenFile(DISK, os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	start := M.NextFileOffeset
+	buffer := make([]byte, BLOCK)
+	for {
+		n, rerr := io.ReadFull(src, buffer)
+		if n > 0 {
+			wn, werr := file.WriteAt(buffer[:n], int64(META_end+M.NextFileOffeset))
+			M.NextFileOffeset += uint64(wn)
+			written += uint64(wn)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return written, err
+	}
+
+	_, err = WRITE_META_RANGE(start, start+written, name)
+	return written, err
+}
+
 func DUMP_META() (err error) {
 	file, err := os.OpenFile(DISK, os.O_WRONLY, 0o644)
 	if err != nil {
@@ -217,11 +321,19 @@ func CREATE_FILE_META_SLICE(
 }
 
 func WRITE_META(data []byte, name string) (written int, err error) {
-	fileMeta := CREATE_FILE_META_SLICE(
+	return WRITE_META_RANGE(
 		M.NextFileOffeset,
 		M.NextFileOffeset+uint64(len(data)),
 		name,
 	)
+}
+
+func WRITE_META_RANGE(start, end uint64, name string) (written int, err error) {
+	fileMeta := CREATE_FILE_META_SLICE(
+		start,
+		end,
+		name,
+	)
 
 	file, err := os.OpenFile(DISK, os.O_WRONLY, 0o644)
 	if err != nil {
@@ -448,48 +560,66 @@ func clearCurrentLine() {
 }
 
 func WIPE(count string) {
-	countInt, _ := strconv.Atoi(count)
-	// Open the device file
-	// defer file.Close()
-	// stat, err := os.Stat(DISK)
-	// fmt.Println(stat, err)
-	// os.Exit(1)
-
-	// written := 0
+	countInt, err := strconv.Atoi(count)
+	if err != nil {
+		fmt.Println("invalid block count:", err)
+		return
+	}
 
 	file, err := os.OpenFile(DISK, os.O_WRONLY, 0o644)
 	if err != nil {
 		log.Fatalf("Error opening file: %v", err)
 	}
-	// count := 1
-	// WIPEBLOCK:
-	// Seek to the position
+	defer file.Close()
+
+	wiped, err := WIPE_BLOCKS(file, data[:], countInt, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("WIPED BYTES:", wiped)
+}
+
+// WIPE_BLOCKS overwrites the first count blocks of len(block) bytes with
+// block, which is expected to be zeroed, and writes a progress line per
+// block to out. WriteAt does not touch the shared file offset so the
+// workers can write to the same file concurrently.
+func WIPE_BLOCKS(file *os.File, block []byte, count int, out io.Writer) (wiped int64, err error) {
+	blocks := make(chan int)
 	var wg sync.WaitGroup
-	for i := 0; i < countInt; i++ {
+	var mu sync.Mutex
+	for w := 0; w < WIPE_WORKERS; w++ {
 		wg.Add(1)
-		go func(f os.File, i int) {
+		go func() {
 			defer wg.Done()
-			fmt.Println("SEEKING:", int64(len(data)*i))
-			_, err = f.Seek(int64(len(data)*i), 0)
-			if err != nil {
-				log.Fatalf("Error seeking file: %v", err)
+			for i := range blocks {
+				mu.Lock()
+				failed := err != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+				offset := int64(len(block)) * int64(i)
+				fmt.Fprintln(out, "WIPING BLOCK:", i, "OFFSET:", offset)
+				n, werr := file.WriteAt(block, offset)
+				mu.Lock()
+				wiped += int64(n)
+				if werr != nil && err == nil {
+					err = werr
+				}
+				mu.Unlock()
 			}
-			// Write data
-			_, err := f.Write(data[:])
-			if err != nil {
-				log.Fatalf("Error writing to file: %v", err)
-			}
-			// file.Sync()
-			fmt.Println("W")
-		}(*file, i)
+		}()
 	}
+
+	for i := 0; i < count; i++ {
+		blocks <- i
+	}
+	close(blocks)
 	wg.Wait()
-	// if written > 1000000000*count {
-	// 	fmt.Println("SYNC!")
-	// 	count++
-	// 	go SYNC(file)
-	// 	time.Sleep(2 * time.Second)
-	// }
-
-	// goto WIPEBLOCK
+	if err != nil {
+		return
+	}
+
+	err = file.Sync()
+	return
 }
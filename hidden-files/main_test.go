@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWipeBlocks(t *testing.T) {
+	const count = 3
+	block := make([]byte, 4096)
+	size := int64(len(block) * count)
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "disk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(bytes.Repeat([]byte{0xff}, int(size)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wiped, err := WIPE_BLOCKS(file, block, count, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wiped != size {
+		t.Fatalf("wiped %d bytes, expected %d", wiped, size)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(out)) != size {
+		t.Fatalf("file is %d bytes, expected %d", len(out), size)
+	}
+	for i, b := range out {
+		if b != 0 {
+			t.Fatalf("byte %d was not wiped", i)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	disk := filepath.Join(t.TempDir(), "disk")
+	err := os.WriteFile(disk, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDisk, oldM := DISK, M
+	defer func() { DISK, M = oldDisk, oldM }()
+	DISK = disk
+
+	var start uint64 = 10
+	M = &META{Files: make(map[int]*FILE), NextFileOffeset: start}
+
+	src := make([]byte, 2*BLOCK+123)
+	for i := range src {
+		src[i] = byte(i % 251)
+	}
+
+	written, err := COPY(bytes.NewReader(src), "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != uint64(len(src)) {
+		t.Fatalf("copied %d bytes, expected %d", written, len(src))
+	}
+	if M.NextFileOffeset != start+written {
+		t.Fatalf("next file offset is %d, expected %d", M.NextFileOffeset, start+written)
+	}
+
+	file, err := os.Open(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	out := make([]byte, len(src))
+	_, err = file.ReadAt(out, int64(META_end+start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Fatal("data on disk does not match the source")
+	}
+
+	metaB, err := READ_META()
+	if err != nil {
+		t.Fatal(err)
+	}
+	PARSE_META(metaB)
+	f, ok := M.Files[0]
+	if !ok {
+		t.Fatal("no meta entry written")
+	}
+	if f.Name != "big" || f.Start != start || f.End != start+written {
+		t.Fatalf("meta entry is %s %d-%d, expected big %d-%d", f.Name, f.Start, f.End, start, start+written)
+	}
+}
+
+func TestLsJSON(t *testing.T) {
+	disk := filepath.Join(t.TempDir(), "disk")
+	content := []byte("hidden file content")
+	var start uint64 = 7
+
+	file, err := os.Create(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt(content, int64(META_end+start))
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDisk, oldM := DISK, M
+	defer func() { DISK, M = oldDisk, oldM }()
+	DISK = disk
+	M = &META{Files: map[int]*FILE{
+		0: {
+			Name:  "a.txt",
+			Start: start,
+			End:   start + uint64(len(content)),
+			Size:  uint64(len(content)),
+		},
+	}}
+
+	var out bytes.Buffer
+	err = LS_JSON(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []LS_ENTRY
+	err = json.Unmarshal(out.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("listed %d entries, expected 1", len(entries))
+	}
+
+	sum := sha256.Sum256(content)
+	want := LS_ENTRY{
+		Index:    0,
+		Name:     "a.txt",
+		Size:     uint64(len(content)),
+		Start:    start,
+		End:      start + uint64(len(content)),
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	if entries[0] != want {
+		t.Fatalf("listed %+v, expected %+v", entries[0], want)
+	}
+}
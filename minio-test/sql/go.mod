@@ -2,4 +2,4 @@ module sdf
 
 go 1.21.1
 
-require github.com/mattn/go-sqlite3 v1.14.19 // indirect
+require github.com/mattn/go-sqlite3 v1.14.19
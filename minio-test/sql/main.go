@@ -2,8 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -15,36 +20,221 @@ const create string = `
   description TEXT
   );`
 
-const file string = "files.db"
+var (
+	file   = "files.db"
+	schema string
+)
 
 type Activities struct {
-	mu sync.Mutex
-	db *sql.DB
+	mu     sync.Mutex
+	db     *sql.DB
+	insert *sql.Stmt
+	list   *sql.Stmt
+}
+
+type Activity struct {
+	ID          int64
+	Time        time.Time
+	Description string
+}
+
+func NewActivities(path string) (*Activities, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Activities{
+		db: db,
+	}, nil
+}
+
+func (a *Activities) Init(schema string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.db.Exec(schema)
+	return err
+}
+
+// prepare lazily prepares stmt on first use, the files table does not
+// exist until init has been run so it can't be done in NewActivities.
+// The caller must hold a.mu.
+func (a *Activities) prepare(stmt **sql.Stmt, query string) (err error) {
+	if *stmt != nil {
+		return nil
+	}
+	*stmt, err = a.db.Prepare(query)
+	return
+}
+
+func (a *Activities) Insert(t time.Time, description string) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.prepare(&a.insert, "INSERT INTO files VALUES(NULL,?,?);")
+	if err != nil {
+		return 0, err
+	}
+	res, err := a.insert.Exec(t, description)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (a *Activities) List() (out []Activity, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err = a.prepare(&a.list, "SELECT id, time, description FROM files ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.list.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v Activity
+		var description sql.NullString
+		if err = rows.Scan(&v.ID, &v.Time, &description); err != nil {
+			return nil, err
+		}
+		v.Description = description.String
+		out = append(out, v)
+	}
+	return out, rows.Err()
 }
 
+func (a *Activities) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.insert != nil {
+		_ = a.insert.Close()
+	}
+	if a.list != nil {
+		_ = a.list.Close()
+	}
+	return a.db.Close()
+}
+
+func (a *Activities) Query(query string) (columns []string, rows [][]interface{}, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stmt, err := a.db.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stmt.Close()
+	r, err := stmt.Query()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	columns, err = r.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	for r.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = r.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, values)
+	}
+	return columns, rows, r.Err()
+}
+
+func usage() {
+	fmt.Println("usage: sql [flags] init")
+	fmt.Println("       sql [flags] insert [description]")
+	fmt.Println("       sql [flags] list")
+	fmt.Println("       sql [flags] query [select statement]")
+	flag.PrintDefaults()
+}
+
+var errUsage = errors.New("invalid arguments")
+
 func main() {
-	db, err := sql.Open("sqlite3", file)
+	flag.StringVar(&file, "db", file, "path to the sqlite database")
+	flag.StringVar(&schema, "schema", "", "path to a file with the schema used by init (defaults to the files table)")
+	flag.Parse()
+
+	err := run(flag.Args())
+	if err == errUsage {
+		usage()
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
-	if _, err := db.Exec(create); err != nil {
-		fmt.Println(err)
-		return
+}
+
+func run(args []string) (err error) {
+	if len(args) < 1 {
+		return errUsage
 	}
-	res, err := db.Exec("INSERT INTO files VALUES(NULL,?,?);", "file1", "jksjdfkljskldfjklsjdlfkjskldf")
+
+	a, err := NewActivities(file)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
+	defer a.Close()
 
-	var id int64
-	if id, err = res.LastInsertId(); err != nil {
-		fmt.Println(err)
-		return
+	switch args[0] {
+	case "init":
+		s := create
+		if schema != "" {
+			sb, err := os.ReadFile(schema)
+			if err != nil {
+				return err
+			}
+			s = string(sb)
+		}
+		return a.Init(s)
+	case "insert":
+		if len(args) < 2 {
+			return errUsage
+		}
+		id, err := a.Insert(time.Now(), strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+	case "list":
+		list, err := a.List()
+		if err != nil {
+			return err
+		}
+		for _, v := range list {
+			fmt.Printf("%d\t%s\t%s\n", v.ID, v.Time.Format(time.RFC3339), v.Description)
+		}
+	case "query":
+		if len(args) < 2 {
+			return errUsage
+		}
+		columns, rows, err := a.Query(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(columns, "\t"))
+		for _, row := range rows {
+			fields := make([]string, len(row))
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					v = string(b)
+				}
+				fields[i] = fmt.Sprint(v)
+			}
+			fmt.Println(strings.Join(fields, "\t"))
+		}
+	default:
+		return errUsage
 	}
-	fmt.Println(id)
-	// return &Activities{
-	//  db: db,
-	// }, nil
+	return nil
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentInsert(t *testing.T) {
+	const workers = 8
+	const inserts = 50
+
+	a, err := NewActivities(filepath.Join(t.TempDir(), "files.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	err = a.Init(create)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*inserts)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < inserts; i++ {
+				_, err := a.Insert(time.Now(), "concurrent")
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	list, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != workers*inserts {
+		t.Fatalf("listed %d rows, expected %d", len(list), workers*inserts)
+	}
+}
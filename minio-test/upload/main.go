@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -15,7 +17,30 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+var (
+	filePath       string
+	bucketName     string
+	objectName     string
+	partSize       uint64
+	forceMultipart bool
+)
+
 func main() {
+	flag.StringVar(&filePath, "file", "", "file to upload with the multipart test")
+	flag.StringVar(&bucketName, "bucket", "", "bucket to upload to")
+	flag.StringVar(&objectName, "object", "", "object name, defaults to the file name")
+	flag.Uint64Var(&partSize, "part-size", 1024*1024*5, "multipart part size in bytes")
+	flag.BoolVar(&forceMultipart, "force-multipart", false, "always upload as multipart, even when the file fits in one part")
+	flag.Parse()
+
+	if filePath != "" {
+		if objectName == "" {
+			objectName = filepath.Base(filePath)
+		}
+		uploadMultipart(filePath, bucketName, objectName, partSize, forceMultipart)
+		return
+	}
+
 	// err := makeFile("file3")
 	// if err != nil {
 	// 	fmt.Println(err)
@@ -238,6 +263,83 @@ func uploadFile(path, bucket, prefix string) {
 	}
 }
 
+// uploadMultipart uploads path in parts of partSize and then checks the part
+// accounting reported by GetObjectAttributes against the expected count.
+func uploadMultipart(path, bucket, prefix string, partSize uint64, force bool) {
+	c, err := minio.New(os.Getenv("endpoint"),
+		&minio.Options{
+			Creds:     credentials.NewStaticV4(os.Getenv("key"), os.Getenv("secret"), ""),
+			Secure:    true,
+			Transport: createHTTPTransport(),
+		})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	PR := new(ProgressReader)
+	PR.F = file
+	PR.S = stat
+	PR.TotalSize = stat.Size()
+
+	// an unknown size makes the sdk use a multipart upload no matter how
+	// small the file is
+	size := stat.Size()
+	if force {
+		size = -1
+	}
+
+	fmt.Println("Uploading file", stat.Size(), "part size", partSize)
+	_, err = c.PutObject(context.Background(), bucket, prefix, PR, size, minio.PutObjectOptions{
+		DisableMultipart: false,
+		PartSize:         partSize,
+	})
+	fmt.Println("")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	expected := int((uint64(stat.Size()) + partSize - 1) / partSize)
+	if expected == 0 {
+		expected = 1
+	}
+	// minio-go only does a single PUT when size < partSize
+	if !force && uint64(stat.Size()) < partSize {
+		expected = 0
+	}
+
+	attr, err := c.GetObjectAttributes(context.Background(), bucket, prefix, minio.ObjectAttributesOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("ETag:", attr.ETag)
+	fmt.Println("ObjectSize:", attr.ObjectSize)
+	for _, v := range attr.ObjectParts.Parts {
+		fmt.Println("Part:", v.PartNumber, "Size:", v.Size)
+	}
+	fmt.Println("PartsCount:", attr.ObjectParts.PartsCount)
+	fmt.Println("ExpectedParts:", expected)
+	if attr.ObjectParts.PartsCount != expected {
+		fmt.Println("PART COUNT MISMATCH")
+		os.Exit(1)
+	}
+}
+
 func createHTTPTransport() (transport *http.Transport) {
 	var err error
 	transport, err = minio.DefaultTransport(true)
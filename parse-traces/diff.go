@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goroutineCounts sums the goroutine count of every distinct stack across
+// files. The stack is keyed on the addresses after " @" and its frames so
+// the same stack matches between dumps of the same binary.
+func goroutineCounts(files map[string]bool) map[string]float64 {
+	counts := make(map[string]float64)
+	for i := range files {
+		allBytes, err := os.ReadFile(i)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		var lines []string
+		for _, v := range bytes.Split(allBytes, []byte{10}) {
+			if len(bytes.TrimSpace(v)) == 0 {
+				continue
+			}
+			lines = append(lines, string(v))
+		}
+
+		for _, trace := range splitTraces(lines) {
+			atIndex := strings.Index(trace[0], " @")
+			count, err := strconv.Atoi(trace[0][:atIndex])
+			if err != nil {
+				continue
+			}
+			stack := strings.Join(append([]string{trace[0][atIndex+1:]}, trace[1:]...), "\n")
+			if filter != "" && !strings.Contains(stack, filter) {
+				continue
+			}
+			counts[stack] += float64(count)
+		}
+	}
+	return counts
+}
+
+// memCounts sums the flat bytes per function line across files.
+func memCounts(files map[string]bool) map[string]float64 {
+	counts := make(map[string]float64)
+	for i := range files {
+		allBytes, err := pprofText(i)
+		if err != nil {
+			panic(err)
+		}
+
+		startAppending := false
+		for _, v := range bytes.Split(allBytes, []byte{10}) {
+			if bytes.Contains(v, []byte("flat%")) {
+				startAppending = true
+				continue
+			}
+			if !startAppending {
+				continue
+			}
+			fields := strings.Fields(string(v))
+			if len(fields) < 6 {
+				continue
+			}
+			name := strings.Join(fields[5:], " ")
+			if filter != "" && !strings.Contains(name, filter) {
+				continue
+			}
+			counts[name] += parseBytes(fields[0])
+		}
+	}
+	return counts
+}
+
+// parseBytes parses pprof sizes like 512B, 1.50kB or 2GB.
+func parseBytes(s string) float64 {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"kB", 1 << 10},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0
+			}
+			return v * u.mult
+		}
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func formatBytes(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1<<30:
+		return fmt.Sprintf("%.2fGB", v/(1<<30))
+	case abs >= 1<<20:
+		return fmt.Sprintf("%.2fMB", v/(1<<20))
+	case abs >= 1<<10:
+		return fmt.Sprintf("%.2fkB", v/(1<<10))
+	}
+	return fmt.Sprintf("%.0fB", v)
+}
+
+func printDiff() {
+	baselineFiles := make(map[string]bool)
+	findProfileFiles(baseline, baselineFiles)
+
+	var current, previous map[string]float64
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }
+	switch profileType {
+	case "goroutine":
+		current = goroutineCounts(fileMap)
+		previous = goroutineCounts(baselineFiles)
+	case "mem":
+		current = memCounts(fileMap)
+		previous = memCounts(baselineFiles)
+		format = formatBytes
+	default:
+		fmt.Println("--baseline is only supported for goroutine and mem profiles")
+		os.Exit(1)
+	}
+
+	type change struct {
+		key    string
+		before float64
+		after  float64
+	}
+	var changes []change
+	for k, v := range current {
+		if math.Abs(v-previous[k]) > diffMin {
+			changes = append(changes, change{k, previous[k], v})
+		}
+	}
+	for k, v := range previous {
+		if _, ok := current[k]; !ok && v > diffMin {
+			changes = append(changes, change{k, v, 0})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return math.Abs(changes[i].after-changes[i].before) > math.Abs(changes[j].after-changes[j].before)
+	})
+
+	fmt.Println("")
+	fmt.Println("CHANGES >>> ", len(changes))
+	for _, c := range changes {
+		delta := c.after - c.before
+		sign := "+"
+		if delta < 0 {
+			sign = "-"
+		}
+		fmt.Println("--------------------------------------------------------")
+		fmt.Printf("%s%s (%s -> %s)\n", sign, format(math.Abs(delta)), format(c.before), format(c.after))
+		fmt.Println(c.key)
+	}
+}
@@ -8,16 +8,21 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
 var (
-	filter      string
-	minCount    int
-	maxCount    int
-	profileType string
-	fileMap     = make(map[string]bool)
+	filter       string
+	minCount     int
+	maxCount     int
+	profileType  string
+	invert       bool
+	contextLines int
+	baseline     string
+	diffMin      float64
+	fileMap      = make(map[string]bool)
 )
 
 func main() {
@@ -25,42 +30,66 @@ func main() {
 	flag.StringVar(&profileType, "type", "", "set the profile type: goroutine,mem,cpu...")
 	flag.IntVar(&minCount, "min", 0, "set min value")
 	flag.IntVar(&maxCount, "max", 0, "set max value")
+	flag.BoolVar(&invert, "invert", false, "keep goroutine traces that do NOT contain the filter")
+	flag.IntVar(&contextLines, "context", 0, "only keep N frames around each frame matching the filter instead of the whole trace")
+	flag.StringVar(&baseline, "baseline", "", "directory with an earlier set of profiles, prints only entries whose counts changed")
+	flag.Float64Var(&diffMin, "diff-min", 0, "only print baseline changes larger than this (goroutines or bytes)")
 	flag.Parse()
 
 	fmt.Println(profileType, minCount, maxCount, filter)
 
-	dr := os.DirFS(".")
+	findProfileFiles(".", fileMap)
+
+	if baseline != "" {
+		printDiff()
+		return
+	}
+
+	switch profileType {
+	case "goroutine":
+		parseGoroutineFiles()
+	case "mem":
+		parseMemFiles()
+	}
+
+	printOutput()
+}
+
+func findProfileFiles(root string, files map[string]bool) {
+	dr := os.DirFS(root)
 	fs.WalkDir(dr, ".", func(path string, d fs.DirEntry, err error) error {
 		switch profileType {
 		case "goroutine":
 			if strings.Contains(path, "goroutines.txt") {
-				fmt.Println("ADD:", path)
-				fileMap[path] = true
+				fmt.Println("ADD:", filepath.Join(root, path))
+				files[filepath.Join(root, path)] = true
 			}
 		case "cpu":
 		case "mem":
 			if strings.Contains(path, "mem.pprof") || strings.Contains(path, "mem-before.pprof") {
-				fmt.Println("ADD:", path)
-				fileMap[path] = true
+				fmt.Println("ADD:", filepath.Join(root, path))
+				files[filepath.Join(root, path)] = true
 			}
 		}
 		return nil
 	})
+}
 
-	switch profileType {
-	case "goroutine":
-		parseGoroutineFiles()
-	case "mem":
-		parseMemFiles()
+// pprofText parses the profile in-process and only shells out to
+// "go tool pprof" when that fails.
+func pprofText(path string) ([]byte, error) {
+	out, err := parseProfile(path)
+	if err == nil {
+		return out, nil
 	}
-
-	printOutput()
+	fmt.Println("in-process parse failed, falling back to go tool pprof:", path, err)
+	cmd := exec.Command("go", "tool", "pprof", "-text", "-lines", "-compact_labels", path)
+	return cmd.CombinedOutput()
 }
 
 func parseMemFiles() {
 	for i := range fileMap {
-		cmd := exec.Command("go", "tool", "pprof", "-text", "-lines", "-compact_labels", i)
-		allBytes, err := cmd.CombinedOutput()
+		allBytes, err := pprofText(i)
 		if err != nil {
 			panic(err)
 		}
@@ -120,21 +149,70 @@ func parseGoroutineFiles() {
 	}
 
 	for i, v := range output {
-		startOfTrace := 0
-		found := false
-		for ii, vv := range v {
-			if strings.Contains(vv, " @") {
-				if found {
-					found = false
-					finalOutput[i] = append(finalOutput[i], v[startOfTrace:ii]...)
+		for _, trace := range splitTraces(v) {
+			var matches []int
+			for ii, vv := range trace {
+				if strings.Contains(vv, filter) {
+					matches = append(matches, ii)
 				}
-				startOfTrace = ii
 			}
-			if strings.Contains(vv, filter) {
-				found = true
+			found := len(matches) > 0
+			if found == invert {
+				continue
+			}
+			if contextLines <= 0 || invert {
+				finalOutput[i] = append(finalOutput[i], trace...)
+				continue
+			}
+			finalOutput[i] = append(finalOutput[i], contextFrames(trace, matches)...)
+		}
+	}
+}
+
+// splitTraces splits lines into traces, each starting at its " @" header line.
+func splitTraces(lines []string) (traces [][]string) {
+	startOfTrace := -1
+	for ii, vv := range lines {
+		if strings.Contains(vv, " @") {
+			if startOfTrace > -1 {
+				traces = append(traces, lines[startOfTrace:ii])
 			}
+			startOfTrace = ii
 		}
 	}
+	if startOfTrace > -1 {
+		traces = append(traces, lines[startOfTrace:])
+	}
+	return
+}
+
+// contextFrames keeps the trace header and the contextLines frames around
+// each match, marking skipped frames with "...".
+func contextFrames(trace []string, matches []int) (out []string) {
+	out = append(out, trace[0])
+	last := 0
+	for _, m := range matches {
+		from := m - contextLines
+		if from <= last {
+			from = last + 1
+		}
+		to := m + contextLines
+		if to > len(trace)-1 {
+			to = len(trace) - 1
+		}
+		if from > to {
+			continue
+		}
+		if from > last+1 {
+			out = append(out, "\t...")
+		}
+		out = append(out, trace[from:to+1]...)
+		last = to
+	}
+	if last < len(trace)-1 {
+		out = append(out, "\t...")
+	}
+	return
 }
 
 var finalOutput = make(map[string][]string)
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+type pprofEntry struct {
+	name string
+	flat int64
+	cum  int64
+}
+
+// parseProfile reads a .pprof file in-process and renders a flat/cum table
+// in the same layout as "go tool pprof -text -lines", so it can be parsed
+// the same way. The profile's default sample type is used.
+func parseProfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.SampleType) == 0 {
+		return nil, fmt.Errorf("%s has no sample types", path)
+	}
+
+	index := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			index = i
+		}
+	}
+	unit := p.SampleType[index].Unit
+
+	entries := make(map[string]*pprofEntry)
+	entry := func(name string) *pprofEntry {
+		e, ok := entries[name]
+		if !ok {
+			e = &pprofEntry{name: name}
+			entries[name] = e
+		}
+		return e
+	}
+
+	var total int64
+	for _, s := range p.Sample {
+		v := s.Value[index]
+		if v == 0 {
+			continue
+		}
+		total += v
+
+		seen := make(map[string]bool)
+		for li, loc := range s.Location {
+			for ii, line := range loc.Line {
+				name := lineName(line)
+				if li == 0 && ii == 0 {
+					entry(name).flat += v
+				}
+				if !seen[name] {
+					seen[name] = true
+					entry(name).cum += v
+				}
+			}
+		}
+	}
+
+	sorted := make([]*pprofEntry, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].flat != sorted[j].flat {
+			return sorted[i].flat > sorted[j].flat
+		}
+		return sorted[i].cum > sorted[j].cum
+	})
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Total: %s\n", formatValue(total, unit))
+	fmt.Fprintf(&out, "%10s %6s %6s %10s %6s\n", "flat", "flat%", "sum%", "cum", "cum%")
+	var sum int64
+	for _, e := range sorted {
+		sum += e.flat
+		fmt.Fprintf(&out, "%10s %6s %6s %10s %6s  %s\n",
+			formatValue(e.flat, unit), percent(e.flat, total), percent(sum, total),
+			formatValue(e.cum, unit), percent(e.cum, total), e.name)
+	}
+	return out.Bytes(), nil
+}
+
+func lineName(line profile.Line) string {
+	if line.Function == nil {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s %s:%d", line.Function.Name, line.Function.Filename, line.Line)
+}
+
+func percent(v, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(v)*100/float64(total))
+}
+
+func formatValue(v int64, unit string) string {
+	if unit != "bytes" {
+		return fmt.Sprintf("%d", v)
+	}
+	return formatBytes(float64(v))
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,16 +18,135 @@ import (
 	"github.com/prometheus/common/model"
 )
 
-var filter = ""
+var (
+	filter     = ""
+	thresholds thresholdList
+)
+
+// exitBreach is returned when a threshold or assert is breached. It is not
+// 2, which the flag package uses for usage errors.
+const exitBreach = 3
+
+// operators are ordered so the two character ones are matched first.
+var operators = []string{">=", "<=", "==", ">", "<"}
+
+// threshold is breached when its condition holds, unless Assert is set in
+// which case it is breached when the condition does not hold.
+type threshold struct {
+	Metric   string
+	Operator string
+	Value    float64
+	Assert   bool
+}
+
+func (t threshold) String() string {
+	if t.Assert {
+		return fmt.Sprintf("assert %s %s %v", t.Metric, t.Operator, t.Value)
+	}
+	return fmt.Sprintf("%s %s %v", t.Metric, t.Operator, t.Value)
+}
+
+func (t threshold) breached(v float64) bool {
+	return t.holds(v) != t.Assert
+}
+
+func (t threshold) holds(v float64) bool {
+	switch t.Operator {
+	case ">=":
+		return v >= t.Value
+	case "<=":
+		return v <= t.Value
+	case "==":
+		return v == t.Value
+	case ">":
+		return v > t.Value
+	case "<":
+		return v < t.Value
+	}
+	return false
+}
+
+func parseThreshold(s string) (t threshold, err error) {
+	for _, op := range operators {
+		index := strings.Index(s, op)
+		if index < 0 {
+			continue
+		}
+		t.Metric = strings.TrimSpace(s[:index])
+		t.Operator = op
+		t.Value, err = strconv.ParseFloat(strings.TrimSpace(s[index+len(op):]), 64)
+		if err != nil {
+			return t, fmt.Errorf("invalid threshold value in %q: %s", s, err)
+		}
+		if t.Metric == "" {
+			return t, fmt.Errorf("missing metric in threshold %q", s)
+		}
+		return t, nil
+	}
+	return t, fmt.Errorf("no operator found in threshold %q, expected one of %s", s, strings.Join(operators, " "))
+}
+
+type thresholdList []threshold
+
+func (l *thresholdList) String() string {
+	out := make([]string, len(*l))
+	for i, v := range *l {
+		out[i] = v.String()
+	}
+	return strings.Join(out, ",")
+}
+
+func (l *thresholdList) Set(s string) error {
+	t, err := parseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, t)
+	return nil
+}
+
+// assertList adds asserts to the same list as the thresholds.
+type assertList struct {
+	list *thresholdList
+}
+
+func (a assertList) String() string {
+	if a.list == nil {
+		return ""
+	}
+	return a.list.String()
+}
+
+func (a assertList) Set(s string) error {
+	t, err := parseThreshold(s)
+	if err != nil {
+		return err
+	}
+	t.Assert = true
+	*a.list = append(*a.list, t)
+	return nil
+}
 
 func main() {
-	if len(os.Args) > 1 {
-		filter = os.Args[1]
+	flag.Var(&thresholds, "threshold", "alert when 'metric>value' holds, supports > < >= <= == and can be repeated, exits 3 on a breach")
+	flag.Var(assertList{&thresholds}, "assert", "fail when 'metric > value' does NOT hold or the metric has no data, supports > < >= <= == and can be repeated, exits 3 on a breach")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		filter = flag.Arg(0)
+	}
+
+	v1api := newAPI()
+	if len(thresholds) > 0 {
+		if checkThresholds(v1api) {
+			os.Exit(exitBreach)
+		}
+		return
 	}
-	getAll()
+	getAll(v1api)
 }
 
-func getAll() {
+func newAPI() v1.API {
 	client, err := api.NewClient(api.Config{
 		Address: "http://localhost:9090",
 	})
@@ -33,8 +154,42 @@ func getAll() {
 		log.Fatal(err)
 	}
 
-	v1api := v1.NewAPI(client)
+	return v1.NewAPI(client)
+}
+
+// checkThresholds queries every threshold metric and prints the samples
+// that breach it, returning true if any did. An assert on a metric with no
+// samples is breached.
+func checkThresholds(v1api v1.API) (breached bool) {
+	for _, t := range thresholds {
+		ctx := context.Background()
+		value, _, err := v1api.Query(ctx, t.Metric, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		vector := value.(model.Vector)
+		if len(vector) == 0 {
+			// a missing metric can't satisfy an assert
+			if t.Assert {
+				breached = true
+				fmt.Printf("BREACH %s no data\n", t)
+				continue
+			}
+			fmt.Printf("NO DATA %s\n", t)
+			continue
+		}
+		for _, sample := range vector {
+			if t.breached(float64(sample.Value)) {
+				breached = true
+				fmt.Printf("BREACH %s %s %s\n", t, sample.Metric, sample.Value)
+			}
+		}
+	}
+	return
+}
 
+func getAll(v1api v1.API) {
 	resp, err := http.Get("http://127.0.0.1:9090/api/v1/targets/metadata")
 	if err != nil {
 		panic(err)
@@ -2,30 +2,85 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
+var (
+	addr        string
+	echo        bool
+	echoHeaders bool
+	status      int
+	delay       time.Duration
+)
+
+type echoResponse struct {
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
 func setupHttpHandlers() {
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		log.Println(r.Method, r.URL.Path, r.RemoteAddr, r.ContentLength)
 		bb, err := io.ReadAll(r.Body)
 		if err != nil {
 			fmt.Println(err)
 		}
 		r.Body.Close()
-		// fmt.Println(string(bb))
 		var out map[string]interface{}
 		err = json.Unmarshal(bb, &out)
-		fmt.Println(out)
+		if err != nil {
+			fmt.Println(string(bb))
+		} else {
+			fmt.Println(out)
+		}
+
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		if echoHeaders {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(echoResponse{
+				Headers: r.Header,
+				Body:    string(bb),
+			})
+			return
+		}
 
-		w.WriteHeader(200)
-		w.Header().Clone()
+		if echo {
+			contentType := r.Header.Get("Content-Type")
+			if contentType == "" {
+				contentType = http.DetectContentType(bb)
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(status)
+			_, _ = w.Write(bb)
+			return
+		}
+
+		w.WriteHeader(status)
 	})
 }
 
 func main() {
+	flag.StringVar(&addr, "addr", ":1111", "address to listen on")
+	flag.BoolVar(&echo, "echo", false, "write the received body back in the response")
+	flag.BoolVar(&echoHeaders, "echo-headers", false, "respond with the request headers and body as JSON")
+	flag.IntVar(&status, "status", 200, "status code returned for every request")
+	flag.DurationVar(&delay, "delay", 0, "time to wait before responding, e.g. 2s")
+	flag.Parse()
+
+	// WriteHeader panics on codes outside this range
+	if status < 100 || status > 999 {
+		log.Fatalf("invalid --status %d, expected 100-999", status)
+	}
+
 	setupHttpHandlers()
-	log.Fatal(http.ListenAndServe("172.17.0.1:1111", nil))
+	log.Fatal(http.ListenAndServe(addr, nil))
 }